@@ -3,26 +3,25 @@ package google
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"net/http/cookiejar"
-	"net/url"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/exp/slices"
-	"golang.org/x/net/publicsuffix"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/impersonate"
 	"google.golang.org/api/option"
 
 	"github.com/dexidp/dex/connector"
+	"github.com/dexidp/dex/connector/synology"
 	pkg_groups "github.com/dexidp/dex/pkg/groups"
 	"github.com/dexidp/dex/pkg/log"
 	"github.com/dexidp/dex/storage"
@@ -62,8 +61,56 @@ type Config struct {
 	// when listing groups
 	DomainToAdminEmail map[string]string
 
+	// Optional principal to impersonate via Workload Identity Federation / ADC impersonation
+	// instead of a service account JSON key. When set, the admin client is built from the
+	// pod's Application Default Credentials impersonating this principal, so Dex running on
+	// GKE with Workload Identity (or anywhere with ADC configured) does not need a long-lived
+	// key mounted into it. If DomainToAdminEmail is also set, the impersonated principal is
+	// further DWD-delegated to the per-domain admin email.
+	ImpersonateTarget string `json:"impersonateTarget"`
+
 	// If this field is true, fetch direct group membership and transitive group membership
+	//
+	// Deprecated: This only applies when Groups is empty and the full group listing is used.
+	// When Groups is non-empty, membership is checked with the Members.hasMember API, which
+	// resolves nested groups server-side, so this flag has no effect.
 	FetchTransitiveGroupMembership bool `json:"fetchTransitiveGroupMembership"`
+
+	// Optional list of claim-enrichment plugins run, in order, from ExtendPayload.
+	PayloadExtenders []PayloadExtenderConfig `json:"payloadExtenders"`
+
+	// Optional interval at which a background goroutine re-validates cached
+	// group memberships, and the maximum age of a cache entry before
+	// createIdentity re-fetches it inline. If zero, no caching is done and
+	// groups are fetched on every login and refresh, as before.
+	GroupsRefreshInterval time.Duration `json:"groupsRefreshInterval"`
+
+	// Optional maximum number of users' groups to keep cached at once.
+	// Defaults to 1000. Only used when GroupsRefreshInterval is set.
+	GroupsCacheSize int `json:"groupsCacheSize"`
+}
+
+// PayloadExtenderConfig selects and configures one connector.PayloadExtender
+// to run from the Google connector's ExtendPayload. Exactly one of the
+// type-specific fields should be set, matching Type.
+type PayloadExtenderConfig struct {
+	// Type selects which of the fields below is used, e.g. "synology".
+	Type string `json:"type"`
+
+	Synology *synology.Config `json:"synology,omitempty"`
+}
+
+// Open instantiates the connector.PayloadExtender selected by Type.
+func (p PayloadExtenderConfig) Open(logger log.Logger) (connector.PayloadExtender, error) {
+	switch p.Type {
+	case "synology":
+		if p.Synology == nil {
+			return nil, fmt.Errorf(`payload extender type "synology" requires a "synology" config block`)
+		}
+		return p.Synology.Open(logger)
+	default:
+		return nil, fmt.Errorf("unknown payload extender type %q", p.Type)
+	}
 }
 
 // Open returns a connector which can be used to login users through Google.
@@ -95,15 +142,15 @@ func (c *Config) Open(id string, logger log.Logger) (conn connector.Connector, e
 
 	// We know impersonation is required when using a service account credential
 	// TODO: or is it?
-	if len(c.DomainToAdminEmail) == 0 && c.ServiceAccountFilePath != "" {
+	if len(c.DomainToAdminEmail) == 0 && c.ServiceAccountFilePath != "" && c.ImpersonateTarget == "" {
 		cancel()
 		return nil, fmt.Errorf("directory service requires the domainToAdminEmail option to be configured")
 	}
 
 	// Fixing a regression caused by default config fallback: https://github.com/dexidp/dex/issues/2699
-	if (c.ServiceAccountFilePath != "" && len(c.DomainToAdminEmail) > 0) || slices.Contains(scopes, "groups") {
+	if ((c.ServiceAccountFilePath != "" || c.ImpersonateTarget != "") && len(c.DomainToAdminEmail) > 0) || slices.Contains(scopes, "groups") {
 		for domain, adminEmail := range c.DomainToAdminEmail {
-			srv, err := createDirectoryService(c.ServiceAccountFilePath, adminEmail, logger)
+			srv, err := createDirectoryService(c.ServiceAccountFilePath, c.ImpersonateTarget, adminEmail, logger)
 			if err != nil {
 				cancel()
 				return nil, fmt.Errorf("could not create directory service: %v", err)
@@ -113,8 +160,41 @@ func (c *Config) Open(id string, logger log.Logger) (conn connector.Connector, e
 		}
 	}
 
+	// Without DomainToAdminEmail, the impersonated principal is used as is,
+	// with no DWD delegation, for every domain.
+	if c.ImpersonateTarget != "" && len(c.DomainToAdminEmail) == 0 {
+		srv, err := createDirectoryService(c.ServiceAccountFilePath, c.ImpersonateTarget, "", logger)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("could not create directory service: %v", err)
+		}
+
+		adminSrv[wildcardDomainToAdminEmail] = srv
+	}
+
+	payloadExtenders := make([]connector.PayloadExtender, 0, len(c.PayloadExtenders))
+	for _, extenderConfig := range c.PayloadExtenders {
+		extender, err := extenderConfig.Open(logger)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("could not open payload extender %q: %v", extenderConfig.Type, err)
+		}
+		payloadExtenders = append(payloadExtenders, extender)
+	}
+
+	var cache *groupsCache
+	if c.GroupsRefreshInterval > 0 {
+		cache = newGroupsCache(c.GroupsCacheSize, id, logger)
+		if err := prometheus.Register(cache); err != nil {
+			// Labelling the counters with id should prevent this in practice,
+			// but log it rather than swallowing it so an operator notices
+			// that this connector's cache metrics are missing from /metrics.
+			logger.Warnf("google: failed to register groups cache metrics for connector %q: %v", id, err)
+		}
+	}
+
 	clientID := c.ClientID
-	return &googleConnector{
+	gc := &googleConnector{
 		redirectURI: c.RedirectURI,
 		oauth2Config: &oauth2.Config{
 			ClientID:     clientID,
@@ -134,7 +214,17 @@ func (c *Config) Open(id string, logger log.Logger) (conn connector.Connector, e
 		domainToAdminEmail:             c.DomainToAdminEmail,
 		fetchTransitiveGroupMembership: c.FetchTransitiveGroupMembership,
 		adminSrv:                       adminSrv,
-	}, nil
+		payloadExtenders:               payloadExtenders,
+		groupsCache:                    cache,
+		groupsRefreshInterval:          c.GroupsRefreshInterval,
+		extendPayloadCtx:               ctx,
+	}
+
+	if cache != nil {
+		go gc.refreshGroupsCachePeriodically(ctx)
+	}
+
+	return gc, nil
 }
 
 var (
@@ -154,10 +244,25 @@ type googleConnector struct {
 	domainToAdminEmail             map[string]string
 	fetchTransitiveGroupMembership bool
 	adminSrv                       map[string]*admin.Service
+	payloadExtenders               []connector.PayloadExtender
+	groupsCache                    *groupsCache
+	groupsRefreshInterval          time.Duration
+	extendPayloadCtx               context.Context
 }
 
 func (c *googleConnector) Close() error {
 	c.cancel()
+
+	var errs []error
+	for _, extender := range c.payloadExtenders {
+		if err := extender.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("google: failed to close payload extenders: %v", errs)
+	}
+
 	return nil
 }
 
@@ -203,7 +308,7 @@ func (c *googleConnector) HandleCallback(s connector.Scopes, r *http.Request) (i
 		return identity, fmt.Errorf("google: failed to get token: %v", err)
 	}
 
-	return c.createIdentity(r.Context(), identity, s, token)
+	return c.createIdentity(r.Context(), identity, s, token, false)
 }
 
 func (c *googleConnector) Refresh(ctx context.Context, s connector.Scopes, identity connector.Identity) (connector.Identity, error) {
@@ -216,10 +321,13 @@ func (c *googleConnector) Refresh(ctx context.Context, s connector.Scopes, ident
 		return identity, fmt.Errorf("google: failed to get token: %v", err)
 	}
 
-	return c.createIdentity(ctx, identity, s, token)
+	// Force a fresh membership check rather than trusting the cache, so a
+	// revoked user is caught here even if the background refresher hasn't
+	// run yet.
+	return c.createIdentity(ctx, identity, s, token, true)
 }
 
-func (c *googleConnector) createIdentity(ctx context.Context, identity connector.Identity, s connector.Scopes, token *oauth2.Token) (connector.Identity, error) {
+func (c *googleConnector) createIdentity(ctx context.Context, identity connector.Identity, s connector.Scopes, token *oauth2.Token, forceGroupsRefresh bool) (connector.Identity, error) {
 	rawIDToken, ok := token.Extra("id_token").(string)
 	if !ok {
 		return identity, errors.New("google: no id_token in token response")
@@ -255,8 +363,11 @@ func (c *googleConnector) createIdentity(ctx context.Context, identity connector
 
 	var groups []string
 	if s.Groups && len(c.adminSrv) > 0 {
-		checkedGroups := make(map[string]struct{})
-		groups, err = c.getGroups(claims.Email, c.fetchTransitiveGroupMembership, checkedGroups)
+		if forceGroupsRefresh || c.groupsCache == nil {
+			groups, err = c.refreshGroups(claims.Email)
+		} else {
+			groups, err = c.cachedGroups(claims.Email)
+		}
 		if err != nil {
 			return identity, fmt.Errorf("google: could not retrieve groups: %v", err)
 		}
@@ -280,9 +391,135 @@ func (c *googleConnector) createIdentity(ctx context.Context, identity connector
 	return identity, nil
 }
 
-// getGroups creates a connection to the admin directory service and lists
-// all groups the user is a member of
+// cachedGroups returns the cached groups for email, re-fetching them via
+// refreshGroups when there is no entry or the cached entry is older than
+// c.groupsRefreshInterval.
+func (c *googleConnector) cachedGroups(email string) ([]string, error) {
+	if groups, ok := c.groupsCache.get(email); ok {
+		return groups, nil
+	}
+	return c.refreshGroups(email)
+}
+
+// refreshGroups fetches email's current groups via getGroups and, if a
+// groupsCache is configured, stores the result for c.groupsRefreshInterval.
+// If c.groups is configured and email is no longer in any of them, any
+// cached entry is purged immediately instead of being refreshed, so the
+// background refresher stops spending API calls on a user who has left and
+// the next login forces a clean fetch rather than trusting a stale hit.
+func (c *googleConnector) refreshGroups(email string) ([]string, error) {
+	checkedGroups := make(map[string]struct{})
+	groups, err := c.getGroups(email, c.fetchTransitiveGroupMembership, checkedGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.groupsCache != nil {
+		if len(c.groups) > 0 && len(pkg_groups.Filter(groups, c.groups)) == 0 {
+			c.groupsCache.delete(email)
+		} else {
+			c.groupsCache.set(email, groups, c.groupsRefreshInterval)
+		}
+	}
+
+	return groups, nil
+}
+
+// refreshGroupsCachePeriodically re-validates every cached user's group
+// membership on a GroupsRefreshInterval tick, borrowing the short
+// "cookie-refresh" idea from oauth2-proxy so that a revoked user doesn't
+// keep a stale Groups claim for the full session lifetime. It runs until ctx
+// is cancelled, which happens when Close calls c.cancel.
+func (c *googleConnector) refreshGroupsCachePeriodically(ctx context.Context) {
+	ticker := time.NewTicker(c.groupsRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, email := range c.groupsCache.emails() {
+				if _, err := c.refreshGroups(email); err != nil {
+					c.logger.Errorf("google: background refresh of groups for %s failed: %v", email, err)
+				}
+			}
+		}
+	}
+}
+
+// getGroups creates a connection to the admin directory service and returns
+// the groups the user is a member of.
+//
+// When c.groups is configured, we only need to prove membership in that
+// known set, so we check each configured group directly via hasMember
+// instead of listing every group the user belongs to. This is O(len(c.groups))
+// round-trips rather than O(number of groups the user is in), and hasMember
+// resolves nested group membership server-side. When c.groups is empty, the
+// full group listing is still required since the ID token needs to carry
+// every group the user is in.
 func (c *googleConnector) getGroups(email string, fetchTransitiveGroupMembership bool, checkedGroups map[string]struct{}) ([]string, error) {
+	if len(c.groups) > 0 {
+		return c.getGroupsViaHasMember(email)
+	}
+	return c.getGroupsViaList(email, fetchTransitiveGroupMembership, checkedGroups)
+}
+
+// getGroupsViaHasMember checks membership of email in each of the configured
+// c.groups using the Members.hasMember API. For members whose primary domain
+// differs from the group's domain, hasMember returns a 400 "invalid" error;
+// in that case we fall back to Members.get, treating a 200 response as
+// membership and a 404 as non-membership.
+func (c *googleConnector) getGroupsViaHasMember(email string) ([]string, error) {
+	domain := c.extractDomainFromEmail(email)
+	adminSrv, err := c.findAdminService(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var userGroups []string
+	for _, groupKey := range c.groups {
+		isMember, err := c.hasMember(adminSrv, groupKey, email)
+		if err != nil {
+			return nil, fmt.Errorf("could not check membership of group %q: %v", groupKey, err)
+		}
+		if isMember {
+			userGroups = append(userGroups, groupKey)
+		}
+	}
+
+	return userGroups, nil
+}
+
+// hasMember reports whether email is a member of groupKey, falling back to
+// Members.get when hasMember rejects the lookup with a 400 because the
+// member's primary domain differs from the group's domain.
+func (c *googleConnector) hasMember(adminSrv *admin.Service, groupKey, email string) (bool, error) {
+	resp, err := adminSrv.Members.HasMember(groupKey, email).Do()
+	if err == nil {
+		return resp.IsMember, nil
+	}
+
+	var gErr *googleapi.Error
+	if !errors.As(err, &gErr) || gErr.Code != http.StatusBadRequest {
+		return false, err
+	}
+
+	_, err = adminSrv.Members.Get(groupKey, email).Do()
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.As(err, &gErr) && gErr.Code == http.StatusNotFound {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// getGroupsViaList lists all groups the user is a member of, optionally
+// recursing into nested groups when fetchTransitiveGroupMembership is set.
+func (c *googleConnector) getGroupsViaList(email string, fetchTransitiveGroupMembership bool, checkedGroups map[string]struct{}) ([]string, error) {
 	var userGroups []string
 	var err error
 	groupsList := &admin.Groups{}
@@ -312,8 +549,8 @@ func (c *googleConnector) getGroups(email string, fetchTransitiveGroupMembership
 				continue
 			}
 
-			// getGroups takes a user's email/alias as well as a group's email/alias
-			transitiveGroups, err := c.getGroups(group.Email, fetchTransitiveGroupMembership, checkedGroups)
+			// getGroupsViaList takes a user's email/alias as well as a group's email/alias
+			transitiveGroups, err := c.getGroupsViaList(group.Email, fetchTransitiveGroupMembership, checkedGroups)
 			if err != nil {
 				return nil, fmt.Errorf("could not list transitive groups: %v", err)
 			}
@@ -357,13 +594,36 @@ func (c *googleConnector) extractDomainFromEmail(email string) string {
 }
 
 // createDirectoryService sets up super user impersonation and creates an admin client for calling
-// the google admin api. If no serviceAccountFilePath is defined, the application default credential
-// is used.
-func createDirectoryService(serviceAccountFilePath, email string, logger log.Logger) (*admin.Service, error) {
+// the google admin api.
+//
+// When impersonateTarget is set, the admin client is built from the application default
+// credentials impersonating that principal via Workload Identity Federation / ADC
+// impersonation (google.golang.org/api/impersonate), so no service account JSON key is
+// required. The per-domain admin email, if any, is applied as DWD delegation (Subject) on
+// top of the impersonated principal.
+//
+// Otherwise, the legacy path is used: if no serviceAccountFilePath is defined, the
+// application default credential is used directly; if it is defined, the service account
+// JSON key is read from disk and used for DWD impersonation of email.
+func createDirectoryService(serviceAccountFilePath, impersonateTarget, email string, logger log.Logger) (*admin.Service, error) {
+	ctx := context.Background()
+
+	if impersonateTarget != "" {
+		ts, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+			TargetPrincipal: impersonateTarget,
+			Scopes:          []string{admin.AdminDirectoryGroupReadonlyScope},
+			Subject:         email,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create impersonated token source: %w", err)
+		}
+
+		return admin.NewService(ctx, option.WithTokenSource(ts))
+	}
+
 	var jsonCredentials []byte
 	var err error
 
-	ctx := context.Background()
 	if serviceAccountFilePath == "" {
 		logger.Warn("the application default credential is used since the service account file path is not used")
 		credential, err := google.FindDefaultCredentials(ctx)
@@ -390,198 +650,20 @@ func createDirectoryService(serviceAccountFilePath, email string, logger log.Log
 	return admin.NewService(ctx, option.WithHTTPClient(config.Client(ctx)))
 }
 
+// ExtendPayload keeps the ctx-less signature dex's connector consumer
+// expects of this optional-capability method; ctx is not available from
+// that call site, so a connector-lifetime context is used for the
+// extenders instead.
 func (c *googleConnector) ExtendPayload(scopes []string, claims storage.Claims, payload []byte, cdata []byte) ([]byte, error) {
 	c.logger.Debugf("ExtendPayload called for claims: %+v", claims)
-	c.logger.Debugf("ExtendPayload called for payload: %s", string(payload))
-
-	email := claims.Email
-
-	c.logger.Debugf("ExtendPayload called for user: %s", email)
-
-	// This is how to authenticate with Synology.
-	// First, login to get a session cookie, then use that cookie to get the user list.
-	//   if ! resp=$(curl --cookie-jar /tmp/jar --cookie /tmp/jar -sS 'https://famille.vls.dev/webapi/entry.cgi' \
-	//   	--data-urlencode api=SYNO.API.Auth \
-	//   	--data-urlencode method=login \
-	//   	--data-urlencode version=6 \
-	//   	--data-urlencode account=mael.valais \
-	//   	--data-urlencode passwd="$(lpass show -p famille.vls.dev)"); then
-	//   	echo "Error: curl failed: $resp"
-	//   	exit 1
-	//   fi
-	//   	if ! jq -e '.success' <<<"$resp" >/dev/null; then
-	//   	echo "Error: SYNO.API.Auth failed: $resp"
-	//   	exit 1
-	//   fi
-	//   	jq -r '.' <<<"$resp" >&2
-	//   	if ! resp=$(curl --cookie-jar /tmp/jar --cookie /tmp/jar -sS 'https://famille.vls.dev/webapi/entry.cgi' \
-	//   		--data-urlencode api=SYNO.Core.User \
-	//   		--data-urlencode method=list \
-	//   		--data-urlencode version=1 \
-	//   		--data-urlencode type=local \
-	//   		--data-urlencode offset=0 \
-	//   		--data-urlencode limit=-1 \
-	//   		--data-urlencode additional='["email","description","expired","2fa_status"]'); then
-	//   	echo "Error: curl failed: $resp"
-	//   	exit 1
-	//   fi
-	//   if ! jq -e '.success' <<<"$resp" >/dev/null; then
-	//   	echo "Error: SYNO.Core.User failed: $resp"
-	//   	exit 1
-	//   fi
-	//   jq -r '.' <<<"$resp" >&2
-
-	// First, get the session cookie
-	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
-	if err != nil {
-		return payload, fmt.Errorf("failed to create cookie jar: %w", err)
-	}
-
-	client := &http.Client{Jar: jar}
-	passwd := os.Getenv("SYNO_PASSWD")
-	if passwd == "" {
-		return payload, errors.New("SYNO_PASSWD not set")
-	}
-
-	user := os.Getenv("SYNO_USER")
-	if user == "" {
-		return payload, errors.New("SYNO_USER not set")
-	}
 
-	synoUrl := os.Getenv("SYNO_URL")
-	if synoUrl == "" {
-		return payload, errors.New("SYNO_URL not set")
-	}
-	synoApi := fmt.Sprintf("%s/webapi/entry.cgi", synoUrl)
-
-	// URL-encode the password.
-	form := url.Values{}
-	form.Add("api", "SYNO.API.Auth")
-	form.Add("method", "login")
-	form.Add("version", "6")
-	form.Add("account", user)
-	form.Add("passwd", passwd)
-	req, err := http.NewRequest("POST", synoApi, strings.NewReader(form.Encode()))
-	if err != nil {
-		return payload, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return payload, fmt.Errorf("failed to do request %s: %w", req.URL, err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		bytes, _ := io.ReadAll(resp.Body)
-		return payload, fmt.Errorf("unexpected status code: %d, body: %v", resp.StatusCode, string(bytes))
-	}
-
-	// Now, get the user list
-	form = url.Values{}
-	form.Add("api", "SYNO.Core.User")
-	form.Add("method", "list")
-	form.Add("version", "1")
-	form.Add("type", "local")
-	form.Add("offset", "0")
-	form.Add("limit", "-1")
-	form.Add("additional", `["email","description","expired","2fa_status"]`)
-	req, err = http.NewRequest("POST", synoApi, strings.NewReader(form.Encode()))
-	if err != nil {
-		return payload, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	resp, err = client.Do(req)
-	if err != nil {
-		return payload, fmt.Errorf("failed to do request %s: %w", req.URL, err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bytes, _ := io.ReadAll(resp.Body)
-		return payload, fmt.Errorf("unexpected status code: %d, body: %v", resp.StatusCode, string(bytes))
-	}
-
-	// Now, parse the response
-	bytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return payload, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	// Example:
-	//
-	//    {
-	//      "data": {
-	//        "offset": 0,
-	//        "total": 9,
-	//        "users": [
-	//          {
-	//            "2fa_status": false,
-	//            "description": "Maël Valais",
-	//            "email": "mael.valais@gmail.com",
-	//            "expired": "normal",
-	//            "name": "mael.valais"
-	//        ]
-	//      },
-	//      "success": true
-	//    }
-	type User struct {
-		TwoFAStatus bool   `json:"2fa_status"`
-		Description string `json:"description"`
-		Email       string `json:"email"`
-		Expired     string `json:"expired"`
-		Name        string `json:"name"`
-	}
-	type Data struct {
-		Offset int    `json:"offset"`
-		Total  int    `json:"total"`
-		Users  []User `json:"users"`
-	}
-	type Response struct {
-		Data    Data   `json:"data"`
-		Success bool   `json:"success"`
-		Error   struct {
-			Code   int `json:"code"`
-			Errors []struct {
-				Code int `json:"code"`
-			} `json:"errors"`
-		} `json:"error"`
-	}
-
-	var response Response
-	err = json.Unmarshal(bytes, &response)
-	if err != nil {
-		return payload, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-
-	if !response.Success {
-		return payload, fmt.Errorf("error: %d", response.Error.Code)
-	}
-
-	// Now, search the email in the list of users.
-	var usr User
-	for _, u := range response.Data.Users {
-		if u.Email == email {
-			usr = u
-			break
+	var err error
+	for _, extender := range c.payloadExtenders {
+		payload, err = extender.ExtendPayload(c.extendPayloadCtx, scopes, claims, payload, cdata)
+		if err != nil {
+			return payload, fmt.Errorf("google: payload extender failed: %w", err)
 		}
 	}
-	if usr == (User{}) {
-		return payload, fmt.Errorf("could not find user with email %s", email)
-	}
 
-	// Now, extend the payload with the user data
-	var originalClaims map[string]interface{}
-	err = json.Unmarshal(payload, &originalClaims)
-	if err != nil {
-		return payload, fmt.Errorf("failed to unmarshal claims: %w", err)
-	}
-	originalClaims["username"] = usr.Name
-	extendedPayload, err := json.Marshal(originalClaims)
-	if err != nil {
-		return payload, fmt.Errorf("failed to marshal claims: %w", err)
-	}
-	c.logger.Debugf("extended payload: %s", extendedPayload)
-	return extendedPayload, nil
+	return payload, nil
 }
@@ -0,0 +1,331 @@
+package google
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	jose "github.com/go-jose/go-jose/v3"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/option"
+
+	"github.com/dexidp/dex/connector"
+)
+
+// membership describes a single group's known members for the fake admin
+// server, plus which of those members should be treated as out-of-domain
+// (i.e. hasMember must reject them with a 400 so the Get fallback kicks in).
+type membership struct {
+	members     map[string]bool
+	outOfDomain map[string]bool
+}
+
+// fakeAdminServer fakes just enough of the Admin SDK Directory API for
+// getGroupsViaHasMember: Members.HasMember and Members.Get.
+func fakeAdminServer(t *testing.T, groups map[string]membership) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/directory/v1/groups/", func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.TrimPrefix(r.URL.Path, "/admin/directory/v1/groups/")
+
+		var groupKey, memberKey string
+		var hasMember bool
+		if before, after, found := strings.Cut(rest, "/hasMember/"); found {
+			groupKey, memberKey, hasMember = before, after, true
+		} else if before, after, found := strings.Cut(rest, "/members/"); found {
+			groupKey, memberKey, hasMember = before, after, false
+		} else {
+			http.NotFound(w, r)
+			return
+		}
+
+		g, ok := groups[groupKey]
+		if hasMember {
+			if g.outOfDomain[memberKey] {
+				writeGoogleError(w, http.StatusBadRequest, "invalid")
+				return
+			}
+			_ = json.NewEncoder(w).Encode(&admin.MembersHasMember{IsMember: ok && g.members[memberKey]})
+			return
+		}
+
+		if ok && g.members[memberKey] {
+			_ = json.NewEncoder(w).Encode(&admin.Member{Email: memberKey})
+			return
+		}
+		writeGoogleError(w, http.StatusNotFound, "notFound")
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func writeGoogleError(w http.ResponseWriter, code int, reason string) {
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"code":   code,
+			"errors": []map[string]any{{"reason": reason}},
+		},
+	})
+}
+
+func newTestGoogleConnector(t *testing.T, serverURL string, groups []string) *googleConnector {
+	t.Helper()
+
+	adminSrv, err := admin.NewService(context.Background(), option.WithEndpoint(serverURL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("failed to create admin service: %v", err)
+	}
+
+	return &googleConnector{
+		logger: logrus.New(),
+		groups: groups,
+		adminSrv: map[string]*admin.Service{
+			wildcardDomainToAdminEmail: adminSrv,
+		},
+	}
+}
+
+func TestGetGroupsViaHasMember(t *testing.T) {
+	groups := map[string]membership{
+		"in-domain@example.com": {
+			members: map[string]bool{"user@example.com": true},
+		},
+		"out-of-domain@example.com": {
+			members:     map[string]bool{"user@other-example.com": true},
+			outOfDomain: map[string]bool{"user@other-example.com": true},
+		},
+		"nested@example.com": {
+			// Membership here is only true because the user belongs to a
+			// child group; hasMember resolves that server-side so the
+			// connector sees a plain hit either way.
+			members: map[string]bool{"user@example.com": true},
+		},
+		"absent@example.com": {
+			// Out-of-domain but not a member, so hasMember's 400 sends the
+			// lookup to Members.get, which answers 404.
+			outOfDomain: map[string]bool{"user@other-example.com": true},
+		},
+	}
+
+	srv := fakeAdminServer(t, groups)
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		email  string
+		groups []string
+		want   []string
+	}{
+		{
+			name:   "in-domain hit",
+			email:  "user@example.com",
+			groups: []string{"in-domain@example.com"},
+			want:   []string{"in-domain@example.com"},
+		},
+		{
+			name:   "out-of-domain fallback via get",
+			email:  "user@other-example.com",
+			groups: []string{"out-of-domain@example.com"},
+			want:   []string{"out-of-domain@example.com"},
+		},
+		{
+			name:   "nested group hit",
+			email:  "user@example.com",
+			groups: []string{"nested@example.com"},
+			want:   []string{"nested@example.com"},
+		},
+		{
+			name:   "404 is treated as non-membership",
+			email:  "user@other-example.com",
+			groups: []string{"absent@example.com"},
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestGoogleConnector(t, srv.URL, tt.groups)
+
+			got, err := c.getGroupsViaHasMember(tt.email)
+			if err != nil {
+				t.Fatalf("getGroupsViaHasMember returned error: %v", err)
+			}
+
+			if !equalGroups(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func equalGroups(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fakeOIDCProvider serves just enough of an OpenID Connect provider
+// (discovery document, JWKS, and token endpoint) for oidc.NewProvider and
+// oauth2.Config.TokenSource to work against it, and signs ID tokens with
+// its own key so googleConnector.verifier can verify them for real.
+type fakeOIDCProvider struct {
+	srv     *httptest.Server
+	signer  jose.Signer
+	idToken string // the ID token returned by the next call to the token endpoint
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, &jose.SignerOptions{
+		ExtraHeaders: map[jose.HeaderKey]interface{}{"kid": "test-key"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	p := &fakeOIDCProvider{signer: signer}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 p.srv.URL,
+			"authorization_endpoint": p.srv.URL + "/auth",
+			"token_endpoint":         p.srv.URL + "/token",
+			"jwks_uri":               p.srv.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "test-key", Algorithm: "RS256", Use: "sig"}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "fake-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     p.idToken,
+		})
+	})
+
+	p.srv = httptest.NewServer(mux)
+	return p
+}
+
+func (p *fakeOIDCProvider) issueIDToken(t *testing.T, clientID, email string) string {
+	t.Helper()
+
+	payload, err := json.Marshal(map[string]any{
+		"iss":            p.srv.URL,
+		"sub":            "user-1",
+		"aud":            clientID,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"email":          email,
+		"email_verified": true,
+		"name":           "alice",
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal claims: %v", err)
+	}
+
+	jws, err := p.signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("failed to sign id_token: %v", err)
+	}
+	raw, err := jws.CompactSerialize()
+	if err != nil {
+		t.Fatalf("failed to serialize id_token: %v", err)
+	}
+	return raw
+}
+
+// TestRefreshEvictsRevokedUserFromCache exercises the request's core ask:
+// when a forced re-fetch during Refresh shows the user is no longer in any
+// of c.groups, Refresh returns an error and the stale cache entry for that
+// user is purged.
+func TestRefreshEvictsRevokedUserFromCache(t *testing.T) {
+	const email = "alice@example.com"
+
+	groups := map[string]membership{
+		"allowed@example.com": {members: map[string]bool{email: true}},
+	}
+	adminSrv := fakeAdminServer(t, groups)
+	defer adminSrv.Close()
+
+	oidcProvider := newFakeOIDCProvider(t)
+	defer oidcProvider.srv.Close()
+
+	ctx := context.Background()
+	provider, err := oidc.NewProvider(ctx, oidcProvider.srv.URL)
+	if err != nil {
+		t.Fatalf("failed to create oidc provider: %v", err)
+	}
+
+	const clientID = "test-client"
+	adminClient, err := admin.NewService(ctx, option.WithEndpoint(adminSrv.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("failed to create admin service: %v", err)
+	}
+
+	cache := newGroupsCache(10, "test-connector", logrus.New())
+	c := &googleConnector{
+		logger: logrus.New(),
+		groups: []string{"allowed@example.com"},
+		oauth2Config: &oauth2.Config{
+			ClientID: clientID,
+			Endpoint: oauth2.Endpoint{TokenURL: oidcProvider.srv.URL + "/token"},
+		},
+		verifier:              provider.Verifier(&oidc.Config{ClientID: clientID}),
+		adminSrv:              map[string]*admin.Service{wildcardDomainToAdminEmail: adminClient},
+		groupsCache:           cache,
+		groupsRefreshInterval: time.Minute,
+	}
+
+	// Seed the cache as if the user had already logged in once while still
+	// a member, so Refresh has something stale to evict.
+	cache.set(email, []string{"allowed@example.com"}, time.Minute)
+
+	// Revoke membership on the admin server, but issue an ID token that
+	// still claims the same email — membership must come from the admin
+	// API check, not the token, for the cache eviction to mean anything.
+	groups["allowed@example.com"].members[email] = false
+	oidcProvider.idToken = oidcProvider.issueIDToken(t, clientID, email)
+
+	_, err = c.Refresh(ctx, connector.Scopes{Groups: true}, connector.Identity{
+		ConnectorData: []byte("some-refresh-token"),
+	})
+	if err == nil {
+		t.Fatal("expected Refresh to return an error for a user no longer in any required group")
+	}
+	if !strings.Contains(err.Error(), "not in any of the required groups") {
+		t.Errorf("got error %q, want it to mention the required groups check", err)
+	}
+
+	if _, ok := cache.get(email); ok {
+		t.Errorf("expected the revoked user's cache entry to be evicted by Refresh")
+	}
+}
@@ -0,0 +1,159 @@
+package google
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/dexidp/dex/pkg/log"
+)
+
+// defaultGroupsCacheSize is used when Config.GroupsCacheSize is left unset.
+const defaultGroupsCacheSize = 1000
+
+// groupsCacheEntry is the value cached per user email.
+type groupsCacheEntry struct {
+	email     string
+	groups    []string
+	expiresAt time.Time
+}
+
+// groupsCache is a bounded, LRU-evicted, concurrency-safe cache of resolved
+// group memberships keyed by user email. It implements prometheus.Collector
+// so hit/miss counters can be scraped alongside the rest of Dex's metrics.
+type groupsCache struct {
+	logger log.Logger
+
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+
+	hits   prometheus.Counter
+	misses prometheus.Counter
+}
+
+var _ prometheus.Collector = (*groupsCache)(nil)
+
+// newGroupsCache builds a cache whose metrics are labelled with connectorID,
+// so multiple Google connector instances (Dex allows several connectors of
+// the same type) can each register their counters without colliding.
+func newGroupsCache(capacity int, connectorID string, logger log.Logger) *groupsCache {
+	if capacity <= 0 {
+		capacity = defaultGroupsCacheSize
+	}
+
+	constLabels := prometheus.Labels{"connector_id": connectorID}
+
+	return &groupsCache{
+		logger:   logger,
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "dex",
+			Subsystem:   "google_connector",
+			Name:        "groups_cache_hits_total",
+			Help:        "Number of times a user's groups were served from the in-memory cache.",
+			ConstLabels: constLabels,
+		}),
+		misses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "dex",
+			Subsystem:   "google_connector",
+			Name:        "groups_cache_misses_total",
+			Help:        "Number of times a user's groups were missing or expired in the in-memory cache.",
+			ConstLabels: constLabels,
+		}),
+	}
+}
+
+// get returns the cached groups for email, if present and not expired.
+func (g *groupsCache) get(email string) ([]string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	el, ok := g.items[email]
+	if !ok {
+		g.misses.Inc()
+		g.logger.Debugf("google: groups cache miss for %s", email)
+		return nil, false
+	}
+
+	entry := el.Value.(*groupsCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		g.misses.Inc()
+		g.logger.Debugf("google: groups cache entry for %s expired", email)
+		return nil, false
+	}
+
+	g.order.MoveToFront(el)
+	g.hits.Inc()
+	g.logger.Debugf("google: groups cache hit for %s", email)
+	return entry.groups, true
+}
+
+// set stores groups for email, valid for ttl, evicting the least recently
+// used entry if the cache is over capacity.
+func (g *groupsCache) set(email string, groups []string, ttl time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+
+	if el, ok := g.items[email]; ok {
+		entry := el.Value.(*groupsCacheEntry)
+		entry.groups = groups
+		entry.expiresAt = expiresAt
+		g.order.MoveToFront(el)
+		return
+	}
+
+	el := g.order.PushFront(&groupsCacheEntry{email: email, groups: groups, expiresAt: expiresAt})
+	g.items[email] = el
+
+	if g.order.Len() > g.capacity {
+		oldest := g.order.Back()
+		if oldest != nil {
+			g.order.Remove(oldest)
+			delete(g.items, oldest.Value.(*groupsCacheEntry).email)
+		}
+	}
+}
+
+// delete removes email from the cache, if present.
+func (g *groupsCache) delete(email string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if el, ok := g.items[email]; ok {
+		g.order.Remove(el)
+		delete(g.items, email)
+	}
+}
+
+// emails returns a snapshot of the emails currently cached, for use by the
+// background refresher.
+func (g *groupsCache) emails() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	emails := make([]string, 0, len(g.items))
+	for email := range g.items {
+		emails = append(emails, email)
+	}
+	return emails
+}
+
+// Describe implements prometheus.Collector.
+func (g *groupsCache) Describe(ch chan<- *prometheus.Desc) {
+	g.hits.Describe(ch)
+	g.misses.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (g *groupsCache) Collect(ch chan<- prometheus.Metric) {
+	g.hits.Collect(ch)
+	g.misses.Collect(ch)
+}
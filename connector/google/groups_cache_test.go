@@ -0,0 +1,71 @@
+package google
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestGroupsCacheGetSet(t *testing.T) {
+	c := newGroupsCache(2, "test-connector", logrus.New())
+
+	if _, ok := c.get("alice@example.com"); ok {
+		t.Fatalf("expected miss on empty cache")
+	}
+
+	c.set("alice@example.com", []string{"eng@example.com"}, time.Minute)
+
+	got, ok := c.get("alice@example.com")
+	if !ok {
+		t.Fatalf("expected hit after set")
+	}
+	if len(got) != 1 || got[0] != "eng@example.com" {
+		t.Errorf("got %v, want [eng@example.com]", got)
+	}
+}
+
+func TestGroupsCacheExpiry(t *testing.T) {
+	c := newGroupsCache(2, "test-connector", logrus.New())
+	c.set("alice@example.com", []string{"eng@example.com"}, -time.Minute)
+
+	if _, ok := c.get("alice@example.com"); ok {
+		t.Fatalf("expected expired entry to be a miss")
+	}
+}
+
+func TestGroupsCacheLRUEviction(t *testing.T) {
+	c := newGroupsCache(2, "test-connector", logrus.New())
+
+	c.set("alice@example.com", []string{"a"}, time.Minute)
+	c.set("bob@example.com", []string{"b"}, time.Minute)
+
+	// Touch alice so bob becomes the least recently used entry.
+	c.get("alice@example.com")
+
+	c.set("carol@example.com", []string{"c"}, time.Minute)
+
+	if _, ok := c.get("bob@example.com"); ok {
+		t.Errorf("expected bob to be evicted as the least recently used entry")
+	}
+	if _, ok := c.get("alice@example.com"); !ok {
+		t.Errorf("expected alice to remain cached")
+	}
+	if _, ok := c.get("carol@example.com"); !ok {
+		t.Errorf("expected carol to be cached")
+	}
+}
+
+func TestGroupsCacheDelete(t *testing.T) {
+	c := newGroupsCache(2, "test-connector", logrus.New())
+	c.set("alice@example.com", []string{"a"}, time.Minute)
+
+	c.delete("alice@example.com")
+
+	if _, ok := c.get("alice@example.com"); ok {
+		t.Errorf("expected alice to be removed from the cache")
+	}
+
+	// Deleting an absent entry is a no-op.
+	c.delete("bob@example.com")
+}
@@ -0,0 +1,24 @@
+package connector
+
+import (
+	"context"
+
+	"github.com/dexidp/dex/storage"
+)
+
+// PayloadExtender enriches the claims payload returned to the client with
+// data from a third-party system (e.g. looking up additional user
+// attributes). Connectors that
+// support this compose one or more PayloadExtenders and invoke them in
+// order from their own ExtendPayload implementation.
+type PayloadExtender interface {
+	// ExtendPayload is given the requested scopes, the claims already
+	// resolved for the user, and the payload built so far, and returns
+	// the payload to use going forward. cdata is the connector-specific
+	// data stored alongside the user's refresh token.
+	ExtendPayload(ctx context.Context, scopes []string, claims storage.Claims, payload []byte, cdata []byte) ([]byte, error)
+
+	// Close releases any resources held by the extender (e.g. persistent
+	// connections or cached sessions).
+	Close() error
+}
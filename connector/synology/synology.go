@@ -0,0 +1,333 @@
+// Package synology implements a connector.PayloadExtender that enriches the
+// claims payload with attributes looked up from a Synology DSM instance's
+// SYNO.API.Auth / SYNO.Core.User webapi.
+package synology
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/dexidp/dex/connector"
+	"github.com/dexidp/dex/pkg/log"
+	"github.com/dexidp/dex/storage"
+)
+
+// sessionTTL is how long a SYNO.API.Auth session cookie is assumed to
+// remain valid before Extender proactively logs in again. Synology does not
+// return an explicit expiry, so this is a conservative default.
+const sessionTTL = 30 * time.Minute
+
+// Config holds the options to configure a Synology PayloadExtender.
+type Config struct {
+	// URL is the base URL of the Synology DSM instance, e.g. "https://nas.example.com:5001".
+	URL string `json:"url"`
+
+	// UsernameRef and PasswordRef are paths to files holding the DSM account
+	// used to authenticate, e.g. a mounted Kubernetes secret path. The
+	// contents are read once, at startup, and trimmed of surrounding whitespace.
+	UsernameRef string `json:"usernameRef"`
+	PasswordRef string `json:"passwordRef"`
+
+	// InsecureSkipVerify disables TLS certificate verification when calling the DSM.
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+
+	// Timeout bounds each call to the DSM webapi. Defaults to 10s.
+	Timeout time.Duration `json:"timeout"`
+
+	// ReuseCookieJar keeps the SYNO.API.Auth session cookie across calls
+	// instead of logging in again for every ExtendPayload invocation.
+	ReuseCookieJar bool `json:"reuseCookieJar"`
+}
+
+// Open reads the configured credentials and returns an Extender.
+func (c *Config) Open(logger log.Logger) (*Extender, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("synology: url is required")
+	}
+
+	username, err := readSecretRef(c.UsernameRef)
+	if err != nil {
+		return nil, fmt.Errorf("synology: failed to read usernameRef: %w", err)
+	}
+
+	password, err := readSecretRef(c.PasswordRef)
+	if err != nil {
+		return nil, fmt.Errorf("synology: failed to read passwordRef: %w", err)
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	transport := &http.Transport{}
+	if c.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} //nolint:gosec
+	}
+
+	e := &Extender{
+		api:            strings.TrimSuffix(c.URL, "/") + "/webapi/entry.cgi",
+		username:       username,
+		password:       password,
+		timeout:        timeout,
+		transport:      transport,
+		reuseCookieJar: c.ReuseCookieJar,
+		logger:         logger,
+	}
+
+	if c.ReuseCookieJar {
+		jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+		if err != nil {
+			return nil, fmt.Errorf("synology: failed to create cookie jar: %w", err)
+		}
+		e.jar = jar
+	}
+
+	return e, nil
+}
+
+func readSecretRef(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("not configured")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// AuthError is returned when SYNO.API.Auth rejects our login, carrying the
+// Synology error code so callers can distinguish it from other failures.
+type AuthError struct {
+	Code int
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("synology: SYNO.API.Auth login failed with code %d", e.Code)
+}
+
+// UserNotFoundError is returned when the requested email does not match any
+// user returned by SYNO.Core.User.
+type UserNotFoundError struct {
+	Email string
+}
+
+func (e *UserNotFoundError) Error() string {
+	return fmt.Sprintf("synology: no user found with email %q", e.Email)
+}
+
+// APIError is returned when a Synology webapi call fails for a reason other
+// than an auth or not-found error, carrying the API name and error code.
+type APIError struct {
+	API  string
+	Code int
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("synology: %s failed with code %d", e.API, e.Code)
+}
+
+type synoUser struct {
+	TwoFAStatus bool   `json:"2fa_status"`
+	Description string `json:"description"`
+	Email       string `json:"email"`
+	Expired     string `json:"expired"`
+	Name        string `json:"name"`
+}
+
+type synoResponse struct {
+	Data struct {
+		Offset int        `json:"offset"`
+		Total  int        `json:"total"`
+		Users  []synoUser `json:"users"`
+	} `json:"data"`
+	Success bool `json:"success"`
+	Error   struct {
+		Code int `json:"code"`
+	} `json:"error"`
+}
+
+// Extender is a connector.PayloadExtender backed by a Synology DSM instance.
+// It is safe for concurrent use.
+type Extender struct {
+	api       string
+	username  string
+	password  string
+	timeout   time.Duration
+	transport http.RoundTripper
+
+	reuseCookieJar bool
+	jar            http.CookieJar
+	logger         log.Logger
+
+	mu         sync.Mutex
+	loggedInAt time.Time
+}
+
+var _ connector.PayloadExtender = (*Extender)(nil)
+
+// ExtendPayload looks up claims.Email in SYNO.Core.User and sets the
+// "username" claim to the matching DSM account name.
+func (e *Extender) ExtendPayload(ctx context.Context, scopes []string, claims storage.Claims, payload []byte, cdata []byte) ([]byte, error) {
+	client, err := e.client(ctx)
+	if err != nil {
+		return payload, err
+	}
+
+	user, err := e.findUser(ctx, client, claims.Email)
+	if err != nil {
+		return payload, err
+	}
+
+	var originalClaims map[string]interface{}
+	if err := json.Unmarshal(payload, &originalClaims); err != nil {
+		return payload, fmt.Errorf("synology: failed to unmarshal claims: %w", err)
+	}
+	originalClaims["username"] = user.Name
+
+	extendedPayload, err := json.Marshal(originalClaims)
+	if err != nil {
+		return payload, fmt.Errorf("synology: failed to marshal claims: %w", err)
+	}
+
+	e.logger.Debugf("synology: extended payload for %s: %s", claims.Email, extendedPayload)
+	return extendedPayload, nil
+}
+
+// Close releases resources held by the extender.
+func (e *Extender) Close() error {
+	if transport, ok := e.transport.(*http.Transport); ok {
+		transport.CloseIdleConnections()
+	}
+	return nil
+}
+
+// client returns an http.Client with a logged-in session cookie, logging in
+// if necessary. When reuseCookieJar is disabled, a fresh client (and
+// session) is built and logged in independently for every call, without
+// holding the connector-wide lock, so concurrent logins aren't serialized
+// through a single shared session.
+func (e *Extender) client(ctx context.Context) (*http.Client, error) {
+	if !e.reuseCookieJar {
+		jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+		if err != nil {
+			return nil, fmt.Errorf("synology: failed to create cookie jar: %w", err)
+		}
+
+		client := &http.Client{Jar: jar, Transport: e.transport, Timeout: e.timeout}
+		if err := e.login(ctx, client); err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+
+	e.mu.Lock()
+	needsLogin := time.Since(e.loggedInAt) >= sessionTTL
+	client := &http.Client{Jar: e.jar, Transport: e.transport, Timeout: e.timeout}
+	e.mu.Unlock()
+
+	if !needsLogin {
+		return client, nil
+	}
+
+	if err := e.login(ctx, client); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.loggedInAt = time.Now()
+	e.mu.Unlock()
+
+	return client, nil
+}
+
+func (e *Extender) login(ctx context.Context, client *http.Client) error {
+	form := url.Values{
+		"api":     {"SYNO.API.Auth"},
+		"method":  {"login"},
+		"version": {"6"},
+		"account": {e.username},
+		"passwd":  {e.password},
+	}
+
+	var resp synoResponse
+	if err := e.do(ctx, client, form, &resp); err != nil {
+		return err
+	}
+	if !resp.Success {
+		return &AuthError{Code: resp.Error.Code}
+	}
+
+	return nil
+}
+
+func (e *Extender) findUser(ctx context.Context, client *http.Client, email string) (*synoUser, error) {
+	form := url.Values{
+		"api":        {"SYNO.Core.User"},
+		"method":     {"list"},
+		"version":    {"1"},
+		"type":       {"local"},
+		"offset":     {"0"},
+		"limit":      {"-1"},
+		"additional": {`["email","description","expired","2fa_status"]`},
+	}
+
+	var resp synoResponse
+	if err := e.do(ctx, client, form, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, &APIError{API: "SYNO.Core.User", Code: resp.Error.Code}
+	}
+
+	for i, u := range resp.Data.Users {
+		if u.Email == email {
+			return &resp.Data.Users[i], nil
+		}
+	}
+
+	return nil, &UserNotFoundError{Email: email}
+}
+
+func (e *Extender) do(ctx context.Context, client *http.Client, form url.Values, out *synoResponse) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.api, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("synology: failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("synology: request to %s failed: %w", form.Get("api"), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("synology: unexpected status code %d from %s: %s", resp.StatusCode, form.Get("api"), string(body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("synology: failed to read response from %s: %w", form.Get("api"), err)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("synology: failed to unmarshal response from %s: %w", form.Get("api"), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package synology
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dexidp/dex/storage"
+)
+
+func writeSecret(t *testing.T, dir, name, value string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(value), 0o600); err != nil {
+		t.Fatalf("failed to write secret %s: %v", name, err)
+	}
+	return path
+}
+
+func newTestExtender(t *testing.T, serverURL string) *Extender {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := &Config{
+		URL:         serverURL,
+		UsernameRef: writeSecret(t, dir, "username", "admin\n"),
+		PasswordRef: writeSecret(t, dir, "password", "hunter2\n"),
+	}
+
+	e, err := cfg.Open(logrus.New())
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	return e
+}
+
+func fakeSynologyServer(t *testing.T, authCode int, users []synoUser, userListCode int) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webapi/entry.cgi", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse form: %v", err)
+		}
+
+		switch r.Form.Get("api") {
+		case "SYNO.API.Auth":
+			resp := synoResponse{Success: authCode == 0}
+			resp.Error.Code = authCode
+			_ = json.NewEncoder(w).Encode(resp)
+		case "SYNO.Core.User":
+			resp := synoResponse{Success: userListCode == 0}
+			resp.Error.Code = userListCode
+			resp.Data.Users = users
+			_ = json.NewEncoder(w).Encode(resp)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestExtendPayload(t *testing.T) {
+	users := []synoUser{
+		{Email: "alice@example.com", Name: "alice"},
+		{Email: "bob@example.com", Name: "bob"},
+	}
+
+	srv := fakeSynologyServer(t, 0, users, 0)
+	defer srv.Close()
+
+	e := newTestExtender(t, srv.URL)
+	defer e.Close()
+
+	payload, err := e.ExtendPayload(context.Background(), nil, storage.Claims{Email: "alice@example.com"}, []byte(`{"sub":"1"}`), nil)
+	if err != nil {
+		t.Fatalf("ExtendPayload returned error: %v", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("failed to unmarshal extended payload: %v", err)
+	}
+
+	if claims["username"] != "alice" {
+		t.Errorf("got username %v, want %q", claims["username"], "alice")
+	}
+}
+
+func TestExtendPayloadUserNotFound(t *testing.T) {
+	srv := fakeSynologyServer(t, 0, nil, 0)
+	defer srv.Close()
+
+	e := newTestExtender(t, srv.URL)
+	defer e.Close()
+
+	_, err := e.ExtendPayload(context.Background(), nil, storage.Claims{Email: "ghost@example.com"}, []byte(`{}`), nil)
+	if _, ok := err.(*UserNotFoundError); !ok {
+		t.Fatalf("got error %v (%T), want *UserNotFoundError", err, err)
+	}
+}
+
+func TestExtendPayloadAuthFailure(t *testing.T) {
+	srv := fakeSynologyServer(t, 400, nil, 0)
+	defer srv.Close()
+
+	e := newTestExtender(t, srv.URL)
+	defer e.Close()
+
+	_, err := e.ExtendPayload(context.Background(), nil, storage.Claims{Email: "alice@example.com"}, []byte(`{}`), nil)
+	authErr, ok := err.(*AuthError)
+	if !ok {
+		t.Fatalf("got error %v (%T), want *AuthError", err, err)
+	}
+	if authErr.Code != 400 {
+		t.Errorf("got code %d, want 400", authErr.Code)
+	}
+}